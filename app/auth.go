@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthClaims is the JWT payload minted by createToken and verified by
+// parseToken, via authMiddleware on authenticated HTTP routes and via the
+// /ws upgrade handler on WebSocket connections.
+type AuthClaims struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+const tokenTTL = 24 * time.Hour
+
+var jwtSecret = []byte(getEnv("JWT_SECRET", "dev-secret-change-me"))
+
+func initAuthTables() {
+	if _, err := db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255) NOT NULL DEFAULT ''`); err != nil {
+		panic(err)
+	}
+}
+
+func registerUser(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to hash password"})
+	}
+
+	query := `
+		INSERT INTO users (username, email, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	var user User
+	user.Username = req.Username
+	user.Email = req.Email
+
+	if err := db.QueryRow(query, user.Username, user.Email, string(hash)).Scan(&user.ID); err != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "User already exists"})
+	}
+
+	return c.Status(201).JSON(user)
+}
+
+func createToken(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var userID int
+	var passwordHash string
+	err := db.QueryRow(
+		`SELECT id, password_hash FROM users WHERE username = $1`,
+		req.Username,
+	).Scan(&userID, &passwordHash)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
+	}
+
+	claims := AuthClaims{
+		UserID:   userID,
+		Username: req.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue token"})
+	}
+
+	return c.JSON(TokenResponse{Token: signed})
+}
+
+// extractToken pulls the bearer token out of the Authorization header, or
+// falls back to a `token` query parameter since browsers can't set custom
+// headers on `new WebSocket(...)`.
+func extractToken(c *fiber.Ctx) string {
+	if auth := c.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return c.Query("token")
+}
+
+func parseToken(raw string) (*AuthClaims, error) {
+	claims := &AuthClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fiber.ErrUnauthorized
+	}
+	return claims, nil
+}
+
+// authMiddleware verifies the request's JWT and stores the resulting
+// principal in c.Locals("principal") for downstream handlers.
+func authMiddleware(c *fiber.Ctx) error {
+	raw := extractToken(c)
+	if raw == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	claims, err := parseToken(raw)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired token"})
+	}
+
+	c.Locals("principal", claims)
+	return c.Next()
+}
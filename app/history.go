@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// CHATHISTORY-style pagination, modeled on IRC's backlog semantics: every
+// page is keyset-paginated on (created_at, id) so it stays O(log N + limit)
+// against idx_messages_created_at regardless of table size.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+	backlogLimit        = 4000
+)
+
+type historyCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+type HistoryResponse struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
+}
+
+func encodeCursor(t time.Time, id int) string {
+	raw := fmt.Sprintf("%d:%d", t.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(token string) (historyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return historyCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return historyCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return historyCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return historyCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+
+	return historyCursor{CreatedAt: time.Unix(0, nanos), ID: id}, nil
+}
+
+// parseHistoryCursor accepts an opaque cursor token, a bare numeric message
+// id, or an RFC 3339 timestamp, matching the `before=<msg_id|timestamp>`
+// contract. A timestamp is treated as the position (timestamp, id 0).
+func parseHistoryCursor(raw string) (historyCursor, error) {
+	if id, err := strconv.Atoi(raw); err == nil {
+		var createdAt time.Time
+		if err := db.QueryRow(`SELECT created_at FROM messages WHERE id = $1`, id).Scan(&createdAt); err != nil {
+			return historyCursor{}, fmt.Errorf("unknown message id: %d", id)
+		}
+		return historyCursor{CreatedAt: createdAt, ID: id}, nil
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return historyCursor{CreatedAt: ts, ID: 0}, nil
+	}
+	return decodeCursor(raw)
+}
+
+func scanHistoryRows(rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Close() error
+}) ([]Message, error) {
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.RoomID, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// getMessageHistory implements CHATHISTORY-style backlog retrieval:
+// before/after/around/between, all keyset-paginated on (created_at, id).
+func getMessageHistory(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultHistoryLimit)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	var roomFilter string
+	var roomArgs []interface{}
+	if roomID := c.QueryInt("room_id", 0); roomID != 0 {
+		roomFilter = " AND room_id = ?"
+		roomArgs = append(roomArgs, roomID)
+	}
+
+	var (
+		messages []Message
+		err      error
+	)
+
+	switch {
+	case c.Query("between") != "":
+		parts := strings.SplitN(c.Query("between"), ",", 2)
+		if len(parts) != 2 {
+			return c.Status(400).JSON(fiber.Map{"error": "between requires two comma-separated cursors"})
+		}
+		lo, err1 := parseHistoryCursor(parts[0])
+		hi, err2 := parseHistoryCursor(parts[1])
+		if err1 != nil || err2 != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid between cursors"})
+		}
+		messages, err = queryHistory(
+			"(created_at, id) >= (?, ?) AND (created_at, id) <= (?, ?)"+roomFilter,
+			append([]interface{}{lo.CreatedAt, lo.ID, hi.CreatedAt, hi.ID}, roomArgs...),
+			"ASC", backlogLimit,
+		)
+
+	case c.Query("around") != "":
+		around, perr := parseHistoryCursor(c.Query("around"))
+		if perr != nil {
+			return c.Status(400).JSON(fiber.Map{"error": perr.Error()})
+		}
+		before, berr := queryHistory(
+			"(created_at, id) < (?, ?)"+roomFilter,
+			append([]interface{}{around.CreatedAt, around.ID}, roomArgs...),
+			"DESC", limit/2,
+		)
+		after, aerr := queryHistory(
+			"(created_at, id) >= (?, ?)"+roomFilter,
+			append([]interface{}{around.CreatedAt, around.ID}, roomArgs...),
+			"ASC", limit-limit/2,
+		)
+		if berr != nil {
+			err = berr
+			break
+		}
+		if aerr != nil {
+			err = aerr
+			break
+		}
+		messages = append(reverseMessages(before), after...)
+
+	case c.Query("after") != "":
+		after, perr := parseHistoryCursor(c.Query("after"))
+		if perr != nil {
+			return c.Status(400).JSON(fiber.Map{"error": perr.Error()})
+		}
+		messages, err = queryHistory(
+			"(created_at, id) > (?, ?)"+roomFilter,
+			append([]interface{}{after.CreatedAt, after.ID}, roomArgs...),
+			"ASC", limit,
+		)
+
+	default:
+		var cursor historyCursor
+		if raw := c.Query("before"); raw != "" {
+			cursor, err = parseHistoryCursor(raw)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		} else {
+			cursor = historyCursor{CreatedAt: time.Now(), ID: int(^uint(0) >> 1)}
+		}
+		var results []Message
+		results, err = queryHistory(
+			"(created_at, id) < (?, ?)"+roomFilter,
+			append([]interface{}{cursor.CreatedAt, cursor.ID}, roomArgs...),
+			"DESC", limit,
+		)
+		messages = reverseMessages(results)
+	}
+
+	if err != nil {
+		log.Println("Failed to query message history:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+	}
+
+	resp := HistoryResponse{Messages: messages}
+	if len(messages) > 0 {
+		first, last := messages[0], messages[len(messages)-1]
+		resp.PrevCursor = encodeCursor(first.CreatedAt, first.ID)
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(resp)
+}
+
+// queryHistory runs a keyset-paginated scan over the messages table. The
+// `?` placeholders in where are rewritten to Postgres' $N form.
+func queryHistory(where string, args []interface{}, order string, limit int) ([]Message, error) {
+	if limit <= 0 || limit > backlogLimit {
+		limit = backlogLimit
+	}
+
+	template := fmt.Sprintf(`
+		SELECT id, user_id, username, content, room_id, created_at
+		FROM messages
+		WHERE %s
+		ORDER BY created_at %s, id %s
+		LIMIT ?
+	`, where, order, order)
+	query := rebind(template)
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanHistoryRows(rows)
+}
+
+// rebind rewrites `?` placeholders into Postgres' positional $N form.
+func rebind(where string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range where {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func reverseMessages(messages []Message) []Message {
+	reversed := make([]Message, len(messages))
+	for i, msg := range messages {
+		reversed[len(messages)-1-i] = msg
+	}
+	return reversed
+}
+
+var historyReplayCount = envInt("HISTORY_REPLAY_COUNT", 20)
+
+func envInt(key string, defaultValue int) int {
+	if raw := getEnv(key, ""); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// replayHistory sends the newly-connected client the last historyReplayCount
+// messages for its room before live broadcast traffic begins.
+func replayHistory(c *websocket.Conn, roomID int) {
+	if historyReplayCount <= 0 {
+		return
+	}
+
+	messages, err := queryHistory(
+		"room_id = ?", []interface{}{roomID}, "DESC", historyReplayCount,
+	)
+	if err != nil {
+		log.Println("Failed to load replay history:", err)
+		return
+	}
+
+	for _, msg := range reverseMessages(messages) {
+		if err := c.WriteJSON(msg); err != nil {
+			log.Println("Failed to replay message:", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeCursorRoundTrip(t *testing.T) {
+	want := historyCursor{CreatedAt: time.Unix(0, 1700000000123456789), ID: 42}
+
+	token := encodeCursor(want.CreatedAt, want.ID)
+	got, err := decodeCursor(token)
+	if err != nil {
+		t.Fatalf("decodeCursor(%q) returned error: %v", token, err)
+	}
+
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("decodeCursor(%q) = %+v, want %+v", token, got, want)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"not-base64!!!",
+		base64.RawURLEncoding.EncodeToString([]byte("missing-colon")),
+		base64.RawURLEncoding.EncodeToString([]byte("abc:42")),
+		base64.RawURLEncoding.EncodeToString([]byte("123:xyz")),
+	}
+
+	for _, token := range cases {
+		if _, err := decodeCursor(token); err == nil {
+			t.Errorf("decodeCursor(%q) returned nil error, want error", token)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"room_id = ?", "room_id = $1"},
+		{"(created_at, id) >= (?, ?) AND (created_at, id) <= (?, ?)", "(created_at, id) >= ($1, $2) AND (created_at, id) <= ($3, $4)"},
+		{"no placeholders here", "no placeholders here"},
+	}
+
+	for _, tc := range cases {
+		if got := rebind(tc.in); got != tc.want {
+			t.Errorf("rebind(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package irc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serverName = "chat-monitoring.irc"
+
+const chatHistoryDefaultLimit = 100
+const chatHistoryMaxLimit = 1000
+
+// client is one IRC connection's session state, from CAP negotiation
+// through SASL auth to room membership.
+type client struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// writeMu serializes writes to writer: run()'s synchronous protocol
+	// replies and Server.Publish's asynchronous broadcasts both call
+	// reply from different goroutines, and bufio.Writer/net.Conn aren't
+	// safe for concurrent writers.
+	writeMu sync.Mutex
+	writer  *bufio.Writer
+
+	nick string
+	user string
+
+	capNegotiating bool
+	saslBuffer     strings.Builder
+
+	authedUserID   int
+	authedUsername string
+
+	rooms map[string]bool
+}
+
+func newClient(s *Server, conn net.Conn) *client {
+	return &client{
+		server: s,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+		rooms:  make(map[string]bool),
+	}
+}
+
+func (c *client) run() {
+	defer func() {
+		c.server.removeClient(c)
+		c.conn.Close()
+	}()
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if err := c.handleLine(line); err != nil {
+			log.Println("irc: client error:", err)
+			return
+		}
+	}
+}
+
+func (c *client) handleLine(line string) error {
+	command, rest := line, ""
+	if idx := strings.IndexByte(line, ' '); idx != -1 {
+		command, rest = line[:idx], line[idx+1:]
+	}
+	command = strings.ToUpper(command)
+
+	switch command {
+	case "CAP":
+		return c.handleCAP(rest)
+	case "AUTHENTICATE":
+		return c.handleAUTHENTICATE(rest)
+	case "NICK":
+		c.nick = strings.TrimPrefix(rest, ":")
+		return nil
+	case "USER":
+		c.user = rest
+		return nil
+	case "PING":
+		return c.reply("PONG %s", rest)
+	case "JOIN":
+		return c.handleJOIN(rest)
+	case "PRIVMSG":
+		return c.handlePRIVMSG(rest)
+	case "CHATHISTORY":
+		return c.handleCHATHISTORY(rest)
+	case "QUIT":
+		return errQuit
+	default:
+		return nil
+	}
+}
+
+func (c *client) handleCAP(rest string) error {
+	fields := splitSpaces(rest)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "LS":
+		c.capNegotiating = true
+		return c.reply("CAP * LS :%s", strings.Join(serverCapabilities, " "))
+	case "REQ":
+		requested := strings.TrimPrefix(strings.Join(fields[1:], " "), ":")
+		return c.reply("CAP * ACK :%s", requested)
+	case "END":
+		c.capNegotiating = false
+		return nil
+	default:
+		return nil
+	}
+}
+
+// handleAUTHENTICATE implements SASL PLAIN: the client sends
+// "AUTHENTICATE PLAIN", we reply "AUTHENTICATE +", then the client sends
+// the base64 authzid\0authcid\0password blob.
+func (c *client) handleAUTHENTICATE(rest string) error {
+	if strings.EqualFold(rest, "PLAIN") {
+		return c.reply("AUTHENTICATE +")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(rest)
+	if err != nil {
+		return c.reply("904 %s :SASL authentication failed", c.nickOrStar())
+	}
+
+	parts := strings.SplitN(string(decoded), "\x00", 3)
+	if len(parts) != 3 {
+		return c.reply("904 %s :SASL authentication failed", c.nickOrStar())
+	}
+	username, password := parts[1], parts[2]
+
+	userID, ok := c.server.store.AuthenticateUser(username, password)
+	if !ok {
+		return c.reply("904 %s :SASL authentication failed", c.nickOrStar())
+	}
+
+	c.authedUserID = userID
+	c.authedUsername = username
+	c.nick = username
+
+	if err := c.reply("900 %s %s :You are now logged in as %s", c.nick, c.nick, username); err != nil {
+		return err
+	}
+	return c.reply("903 %s :SASL authentication successful", c.nick)
+}
+
+func (c *client) handleJOIN(rest string) error {
+	if c.authedUserID == 0 {
+		return c.reply("451 JOIN :You have not registered")
+	}
+
+	for _, channel := range splitSpaces(rest) {
+		channel = strings.TrimSuffix(channel, ",")
+		roomName := strings.TrimPrefix(channel, "#")
+
+		roomID, ok := c.server.store.RoomIDByName(roomName)
+		if !ok {
+			if err := c.reply("403 %s %s :No such room", c.nick, channel); err != nil {
+				return err
+			}
+			continue
+		}
+
+		c.rooms[channel] = true
+		c.server.subscribe(roomID, c)
+
+		if err := c.reply(":%s!%s@%s JOIN %s", c.nick, c.authedUsername, serverName, channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) handlePRIVMSG(rest string) error {
+	if c.authedUserID == 0 {
+		return c.reply("451 PRIVMSG :You have not registered")
+	}
+
+	parts := strings.SplitN(rest, " :", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	channel, text := parts[0], parts[1]
+	roomName := strings.TrimPrefix(channel, "#")
+
+	roomID, ok := c.server.store.RoomIDByName(roomName)
+	if !ok {
+		return c.reply("403 %s %s :No such room", c.nick, channel)
+	}
+
+	_, err := c.server.store.SaveMessage(roomID, c.authedUserID, c.authedUsername, text)
+	if err != nil {
+		log.Println("irc: failed to save message:", err)
+	}
+	return nil
+}
+
+// handleCHATHISTORY implements the BEFORE/AFTER/LATEST subset of the
+// IRCv3 draft/chathistory spec on top of the existing history store.
+// BEFORE/AFTER take a timestamp reference, given as `timestamp=<RFC 3339>`
+// or as a bare RFC 3339 time; msgid references are not supported.
+func (c *client) handleCHATHISTORY(rest string) error {
+	fields := splitSpaces(rest)
+	if len(fields) < 2 {
+		return nil
+	}
+
+	subcommand := strings.ToUpper(fields[0])
+	channel := fields[1]
+	roomName := strings.TrimPrefix(channel, "#")
+	roomID, ok := c.server.store.RoomIDByName(roomName)
+	if !ok {
+		return c.reply("403 %s %s :No such room", c.nick, channel)
+	}
+
+	var (
+		messages []HistoryMessage
+		err      error
+	)
+
+	switch subcommand {
+	case "LATEST":
+		limit := chatHistoryDefaultLimit
+		if len(fields) >= 3 {
+			limit = parseLimit(fields[len(fields)-1], chatHistoryDefaultLimit, chatHistoryMaxLimit)
+		}
+		messages, err = c.server.store.HistoryLatest(roomID, limit)
+
+	case "BEFORE":
+		if len(fields) < 4 {
+			return nil
+		}
+		ts, perr := time.Parse(time.RFC3339, strings.TrimPrefix(fields[2], "timestamp="))
+		if perr != nil {
+			return nil
+		}
+		limit := parseLimit(fields[3], chatHistoryDefaultLimit, chatHistoryMaxLimit)
+		messages, err = c.server.store.HistoryBefore(roomID, ts, limit)
+
+	case "AFTER":
+		if len(fields) < 4 {
+			return nil
+		}
+		ts, perr := time.Parse(time.RFC3339, strings.TrimPrefix(fields[2], "timestamp="))
+		if perr != nil {
+			return nil
+		}
+		limit := parseLimit(fields[3], chatHistoryDefaultLimit, chatHistoryMaxLimit)
+		messages, err = c.server.store.HistoryAfter(roomID, ts, limit)
+
+	default:
+		return nil
+	}
+
+	if err != nil {
+		log.Println("irc: chathistory query failed:", err)
+		return nil
+	}
+
+	batchID := "history"
+	if err := c.reply("BATCH +%s chathistory %s", batchID, channel); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		username := sanitizeProtocolText(msg.Username)
+		content := sanitizeProtocolText(msg.Content)
+		if err := c.reply("@%s;batch=%s :%s!%s@%s PRIVMSG %s :%s",
+			serverTimeTag(msg.CreatedAt), batchID, username, username, serverName, channel, content); err != nil {
+			return err
+		}
+	}
+	return c.reply("BATCH -%s", batchID)
+}
+
+func (c *client) sendPrivmsg(roomName string, msg HistoryMessage) {
+	channel := "#" + roomName
+	username := sanitizeProtocolText(msg.Username)
+	content := sanitizeProtocolText(msg.Content)
+	c.reply("@%s :%s!%s@%s PRIVMSG %s :%s",
+		serverTimeTag(msg.CreatedAt), username, username, serverName, channel, content)
+}
+
+func (c *client) nickOrStar() string {
+	if c.nick == "" {
+		return "*"
+	}
+	return c.nick
+}
+
+func (c *client) reply(format string, args ...interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writeLine(c.writer, format, args...)
+}
+
+var errQuit = quitError{}
+
+type quitError struct{}
+
+func (quitError) Error() string { return "client sent QUIT" }
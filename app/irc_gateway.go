@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	"github.com/silvitreatment/go-chat-monitoring/app/irc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ircStore adapts the existing db-backed hub to irc.Store so the IRC
+// gateway reuses the same rooms, auth and history logic as the
+// HTTP/WebSocket side instead of keeping its own copy.
+type ircStore struct{}
+
+func (ircStore) AuthenticateUser(username, password string) (int, bool) {
+	var userID int
+	var passwordHash string
+	err := db.QueryRow(
+		`SELECT id, password_hash FROM users WHERE username = $1`,
+		username,
+	).Scan(&userID, &passwordHash)
+	if err != nil {
+		return 0, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+func (ircStore) RoomIDByName(name string) (int, bool) {
+	return roomIDByName(name)
+}
+
+func (ircStore) SaveMessage(roomID, userID int, username, content string) (irc.HistoryMessage, error) {
+	msg := Message{
+		UserID:    userID,
+		Username:  username,
+		Content:   content,
+		RoomID:    roomID,
+		CreatedAt: time.Now(),
+	}
+	if err := saveMessage(&msg); err != nil {
+		return irc.HistoryMessage{}, err
+	}
+
+	messagesTotal.WithLabelValues(roomIDLabel(roomID)).Inc()
+	go notifyMentions(msg)
+	select {
+	case broadcast <- msg:
+	default:
+	}
+
+	return irc.HistoryMessage{ID: msg.ID, Username: msg.Username, Content: msg.Content, CreatedAt: msg.CreatedAt}, nil
+}
+
+func (ircStore) HistoryLatest(roomID, limit int) ([]irc.HistoryMessage, error) {
+	messages, err := queryHistory("room_id = ?", []interface{}{roomID}, "DESC", limit)
+	if err != nil {
+		return nil, err
+	}
+	return toIRCHistory(reverseMessages(messages)), nil
+}
+
+func (ircStore) HistoryBefore(roomID int, before time.Time, limit int) ([]irc.HistoryMessage, error) {
+	messages, err := queryHistory("room_id = ? AND created_at < ?", []interface{}{roomID, before}, "DESC", limit)
+	if err != nil {
+		return nil, err
+	}
+	return toIRCHistory(reverseMessages(messages)), nil
+}
+
+func (ircStore) HistoryAfter(roomID int, after time.Time, limit int) ([]irc.HistoryMessage, error) {
+	messages, err := queryHistory("room_id = ? AND created_at > ?", []interface{}{roomID, after}, "ASC", limit)
+	if err != nil {
+		return nil, err
+	}
+	return toIRCHistory(messages), nil
+}
+
+func toIRCHistory(messages []Message) []irc.HistoryMessage {
+	out := make([]irc.HistoryMessage, len(messages))
+	for i, msg := range messages {
+		out[i] = irc.HistoryMessage{ID: msg.ID, Username: msg.Username, Content: msg.Content, CreatedAt: msg.CreatedAt}
+	}
+	return out
+}
+
+// publishToIRC fans a broadcast message (from HTTP, WebSocket or IRC) out to
+// any IRC clients joined to its room.
+func publishToIRC(msg Message) {
+	if ircServer == nil {
+		return
+	}
+	roomName, ok := roomNameByID(msg.RoomID)
+	if !ok {
+		return
+	}
+	ircServer.Publish(roomName, irc.HistoryMessage{ID: msg.ID, Username: msg.Username, Content: msg.Content, CreatedAt: msg.CreatedAt})
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,6 +17,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/silvitreatment/go-chat-monitoring/app/irc"
 )
 
 type Message struct {
@@ -23,6 +25,7 @@ type Message struct {
 	UserID    int       `json:"user_id" db:"user_id"`
 	Username  string    `json:"username" db:"username"`
 	Content   string    `json:"content" db:"content"`
+	RoomID    int       `json:"room_id" db:"room_id"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -33,9 +36,8 @@ type User struct {
 }
 
 type CreateMessageRequest struct {
-	UserID   int    `json:"user_id" validate:"required"`
-	Username string `json:"username" validate:"required"`
-	Content  string `json:"content" validate:"required,min=1,max=1000"`
+	Content string `json:"content" validate:"required,min=1,max=1000"`
+	RoomID  int    `json:"room_id"`
 }
 
 type CreateUserRequest struct {
@@ -44,9 +46,16 @@ type CreateUserRequest struct {
 }
 
 var (
-	db        *sql.DB
+	db *sql.DB
+
+	// hubMu guards every hub map that's shared between a connection's own
+	// goroutine and handleBroadcast/notifyMentions/notifyOfflinePush: clients,
+	// connUsers, roomClients (rooms.go) and outboundQueues (ratelimit.go).
+	hubMu     sync.Mutex
 	clients   = make(map[*websocket.Conn]bool)
+	connUsers = make(map[*websocket.Conn]int)
 	broadcast = make(chan Message)
+	ircServer *irc.Server
 
 	httpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -56,18 +65,20 @@ var (
 		[]string{"method", "endpoint", "status"},
 	)
 
-	messagesTotal = prometheus.NewCounter(
+	messagesTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "messages_total",
 			Help: "Total number of messages sent",
 		},
+		[]string{"room"},
 	)
 
-	activeConnections = prometheus.NewGauge(
+	activeConnections = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "websocket_connections_active",
 			Help: "Number of active WebSocket connections",
 		},
+		[]string{"room"},
 	)
 )
 
@@ -134,6 +145,11 @@ func initDatabase() {
 		log.Fatal("Failed to create tables:", err)
 	}
 
+	initAuthTables()
+	initRoomTables()
+	initPushTables()
+	initNotificationTables()
+
 	log.Println("Database tables initialized")
 }
 
@@ -160,15 +176,49 @@ func metricsMiddleware(c *fiber.Ctx) error {
 }
 
 func handleWebSocket(c *websocket.Conn) {
+	principal, ok := c.Locals("principal").(*AuthClaims)
+	if !ok {
+		c.WriteJSON(fiber.Map{"error": "unauthorized"})
+		c.Close()
+		return
+	}
+
+	roomID := defaultRoomID
+	if raw, ok := c.Locals("room").(string); ok && raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			roomID = parsed
+		}
+	}
+	if !roomExists(roomID) {
+		c.WriteJSON(fiber.Map{"error": "room not found"})
+		c.Close()
+		return
+	}
+
+	hubMu.Lock()
 	clients[c] = true
-	activeConnections.Inc()
+	connUsers[c] = principal.UserID
+	hubMu.Unlock()
+	registerRoomClient(roomID, c)
+	activeConnections.WithLabelValues(roomIDLabel(roomID)).Inc()
+
+	replayHistory(c, roomID)
+	registerOutboundQueue(c)
 
 	defer func() {
+		hubMu.Lock()
 		delete(clients, c)
-		activeConnections.Dec()
+		delete(connUsers, c)
+		hubMu.Unlock()
+		unregisterRoomClient(roomID, c)
+		unregisterOutboundQueue(c)
+		activeConnections.WithLabelValues(roomIDLabel(roomID)).Dec()
 		c.Close()
 	}()
 
+	limiter := newTokenBucket(upstreamMessageBurst, upstreamMessageDelay)
+	violations := 0
+
 	for {
 		var msg Message
 		if err := c.ReadJSON(&msg); err != nil {
@@ -176,39 +226,72 @@ func handleWebSocket(c *websocket.Conn) {
 			break
 		}
 
+		if !limiter.Allow() {
+			chatRateLimitedTotal.Inc()
+			enqueueOutbound(c, rateLimitExceededFrame())
+			violations++
+			if violations >= maxRateLimitViolations {
+				log.Println("Disconnecting client for repeated rate limit violations")
+				break
+			}
+			continue
+		}
+
+		msg.UserID = principal.UserID
+		msg.Username = principal.Username
+		msg.RoomID = roomID
+
 		msg.CreatedAt = time.Now()
 		if err := saveMessage(&msg); err != nil {
 			log.Println("Error saving message:", err)
 			continue
 		}
 
-		messagesTotal.Inc()
+		messagesTotal.WithLabelValues(roomIDLabel(roomID)).Inc()
+		go notifyMentions(msg)
 		broadcast <- msg
 	}
 }
 
+// isUserConnectedToRoom reports whether the given user holds a live
+// WebSocket connection to roomID specifically - a user connected to a
+// different room is not considered online for this one.
+func isUserConnectedToRoom(userID, roomID int) bool {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+
+	for conn := range roomClients[roomID] {
+		if connUsers[conn] == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func handleBroadcast() {
 	for {
 		msg := <-broadcast
 
-		for client := range clients {
-			if err := client.WriteJSON(msg); err != nil {
-				log.Println("WebSocket write error:", err)
-				client.Close()
-				delete(clients, client)
-				activeConnections.Dec()
-			}
+		for _, client := range roomClientsSnapshot(msg.RoomID) {
+			enqueueOutbound(client, msg)
 		}
+
+		go notifyOfflinePush(msg)
+		go publishToIRC(msg)
 	}
 }
 
 func saveMessage(msg *Message) error {
+	if msg.RoomID == 0 {
+		msg.RoomID = defaultRoomID
+	}
+
 	query := `
-		INSERT INTO messages (user_id, username, content, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO messages (user_id, username, content, room_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
 	`
-	return db.QueryRow(query, msg.UserID, msg.Username, msg.Content, msg.CreatedAt).Scan(&msg.ID)
+	return db.QueryRow(query, msg.UserID, msg.Username, msg.Content, msg.RoomID, msg.CreatedAt).Scan(&msg.ID)
 }
 
 func getMessages(c *fiber.Ctx) error {
@@ -216,7 +299,7 @@ func getMessages(c *fiber.Ctx) error {
 	offset := c.QueryInt("offset", 0)
 
 	query := `
-		SELECT id, user_id, username, content, created_at
+		SELECT id, user_id, username, content, room_id, created_at
 		FROM messages
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -231,7 +314,7 @@ func getMessages(c *fiber.Ctx) error {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.RoomID, &msg.CreatedAt); err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan message"})
 		}
 		messages = append(messages, msg)
@@ -241,15 +324,21 @@ func getMessages(c *fiber.Ctx) error {
 }
 
 func createMessage(c *fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(*AuthClaims)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
 	var req CreateMessageRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
 	msg := Message{
-		UserID:    req.UserID,
-		Username:  req.Username,
+		UserID:    principal.UserID,
+		Username:  principal.Username,
 		Content:   req.Content,
+		RoomID:    req.RoomID,
 		CreatedAt: time.Now(),
 	}
 
@@ -257,7 +346,8 @@ func createMessage(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to save message"})
 	}
 
-	messagesTotal.Inc()
+	messagesTotal.WithLabelValues(roomIDLabel(msg.RoomID)).Inc()
+	go notifyMentions(msg)
 
 	select {
 	case broadcast <- msg:
@@ -322,7 +412,7 @@ func healthCheck(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status":      "healthy",
 		"timestamp":   time.Now(),
-		"connections": len(clients),
+		"connections": connectedClientCount(),
 	})
 }
 
@@ -335,16 +425,30 @@ func getStats(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"messages":           messageCount,
 		"users":              userCount,
-		"active_connections": len(clients),
+		"active_connections": connectedClientCount(),
 		"uptime":             time.Since(time.Now()).String(),
 	})
 }
 
+func connectedClientCount() int {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+	return len(clients)
+}
+
 func main() {
 	connectDB()
 	defer db.Close()
 
 	go handleBroadcast()
+	go prunePushSubscriptions()
+
+	ircServer = irc.NewServer(getEnv("IRC_ADDR", ":6667"), ircStore{})
+	go func() {
+		if err := ircServer.ListenAndServe(); err != nil {
+			log.Println("IRC gateway error:", err)
+		}
+	}()
 
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
@@ -366,15 +470,37 @@ func main() {
 
 	api := app.Group("/api/v1")
 
+	api.Post("/auth/register", registerUser)
+	api.Post("/auth/tokens", createToken)
+
 	api.Get("/messages", getMessages)
-	api.Post("/messages", createMessage)
+	api.Post("/messages", authMiddleware, createMessage)
+	api.Get("/messages/history", getMessageHistory)
 
 	api.Get("/users", getUsers)
 	api.Post("/users", createUser)
 
+	api.Get("/rooms", getRooms)
+	api.Post("/rooms", authMiddleware, createRoom)
+	api.Get("/rooms/:id/messages", getRoomMessages)
+
+	api.Get("/push/vapid", getVapidPublicKey)
+	api.Post("/push", authMiddleware, registerPushSubscription)
+	api.Delete("/push", authMiddleware, unregisterPushSubscription)
+
+	api.Get("/notifications", authMiddleware, getNotifications)
+	api.Post("/notifications/read-all", authMiddleware, markAllNotificationsRead)
+	api.Post("/notifications/:id/read", authMiddleware, markNotificationRead)
+
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
+			claims, err := parseToken(extractToken(c))
+			if err != nil {
+				return fiber.ErrUnauthorized
+			}
 			c.Locals("allowed", true)
+			c.Locals("room", c.Query("room"))
+			c.Locals("principal", claims)
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
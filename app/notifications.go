@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+type Notification struct {
+	ID          int             `json:"id" db:"id"`
+	RecipientID int             `json:"recipient_id" db:"recipient_id"`
+	Type        string          `json:"type" db:"type"`
+	Subject     string          `json:"subject" db:"subject"`
+	Body        string          `json:"body" db:"body"`
+	Metadata    json.RawMessage `json:"metadata" db:"metadata"`
+	ReadAt      *time.Time      `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+type NotificationsResponse struct {
+	Count int            `json:"count"`
+	Data  []Notification `json:"data"`
+}
+
+var mentionPattern = regexp.MustCompile(`@([a-zA-Z0-9_]{3,50})`)
+
+func initNotificationTables() {
+	createTables := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id SERIAL PRIMARY KEY,
+		recipient_id INTEGER NOT NULL REFERENCES users(id),
+		type VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL,
+		metadata JSONB NOT NULL DEFAULT '{}',
+		read_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notifications_recipient_id ON notifications(recipient_id);
+	`
+
+	if _, err := db.Exec(createTables); err != nil {
+		log.Fatal("Failed to create notification tables:", err)
+	}
+}
+
+// getNotifications returns the caller's inbox; by default only unread
+// notifications are returned, matching `past=false`.
+func getNotifications(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	take := c.QueryInt("take", 20)
+	offset := c.QueryInt("offset", 0)
+	past := c.QueryBool("past", false)
+
+	query := `
+		SELECT id, recipient_id, type, subject, body, metadata, read_at, created_at
+		FROM notifications
+		WHERE recipient_id = $1
+	`
+	args := []interface{}{principal.UserID}
+	if !past {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+	args = append(args, take, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.RecipientID, &n.Type, &n.Subject, &n.Body, &n.Metadata, &n.ReadAt, &n.CreatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan notification"})
+		}
+		notifications = append(notifications, n)
+	}
+
+	return c.JSON(NotificationsResponse{Count: len(notifications), Data: notifications})
+}
+
+func markNotificationRead(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid notification id"})
+	}
+
+	result, err := db.Exec(
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = $1 AND recipient_id = $2 AND read_at IS NULL`,
+		id, principal.UserID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to mark notification read"})
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Notification not found"})
+	}
+
+	return c.SendStatus(204)
+}
+
+func markAllNotificationsRead(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	if _, err := db.Exec(
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE recipient_id = $1 AND read_at IS NULL`,
+		principal.UserID,
+	); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to mark notifications read"})
+	}
+
+	return c.SendStatus(204)
+}
+
+// notifyMentions scans msg.Content for @username tokens, records a
+// notification per mentioned recipient, and pushes a lightweight frame to
+// any of their live WebSocket connections.
+func notifyMentions(msg Message) {
+	matches := mentionPattern.FindAllStringSubmatch(msg.Content, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		username := match[1]
+		if seen[username] || strings.EqualFold(username, msg.Username) {
+			continue
+		}
+		seen[username] = true
+
+		var recipientID int
+		if err := db.QueryRow(`SELECT id FROM users WHERE username = $1`, username).Scan(&recipientID); err != nil {
+			continue
+		}
+
+		subject := "You were mentioned by " + msg.Username
+		metadata, _ := json.Marshal(fiber.Map{"message_id": msg.ID, "room_id": msg.RoomID})
+
+		var n Notification
+		err := db.QueryRow(
+			`INSERT INTO notifications (recipient_id, type, subject, body, metadata)
+			 VALUES ($1, 'mention', $2, $3, $4)
+			 RETURNING id, read_at, created_at`,
+			recipientID, subject, msg.Content, metadata,
+		).Scan(&n.ID, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			log.Println("Failed to save mention notification:", err)
+			continue
+		}
+
+		n.RecipientID = recipientID
+		n.Type = "mention"
+		n.Subject = subject
+		n.Body = msg.Content
+		n.Metadata = metadata
+
+		pushNotificationFrame(recipientID, n)
+	}
+}
+
+func pushNotificationFrame(userID int, n Notification) {
+	hubMu.Lock()
+	var conns []*websocket.Conn
+	for conn, uid := range connUsers {
+		if uid == userID {
+			conns = append(conns, conn)
+		}
+	}
+	hubMu.Unlock()
+
+	for _, conn := range conns {
+		enqueueOutbound(conn, fiber.Map{"type": "notification", "notification": n})
+	}
+}
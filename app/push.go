@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type PushSubscription struct {
+	ID         int       `json:"id" db:"id"`
+	UserID     int       `json:"user_id" db:"user_id"`
+	RoomID     int       `json:"room_id" db:"room_id"`
+	Endpoint   string    `json:"endpoint" db:"endpoint"`
+	P256dh     string    `json:"p256dh" db:"p256dh"`
+	Auth       string    `json:"auth" db:"auth"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+type RegisterPushSubscriptionRequest struct {
+	RoomID   int    `json:"room_id" validate:"required"`
+	Endpoint string `json:"endpoint" validate:"required"`
+	P256dh   string `json:"p256dh" validate:"required"`
+	Auth     string `json:"auth" validate:"required"`
+}
+
+type UnregisterPushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" validate:"required"`
+}
+
+type pushMessagePayload struct {
+	MessageID int    `json:"message_id"`
+	Username  string `json:"username"`
+	Snippet   string `json:"snippet"`
+}
+
+// webpushCheckSubscriptionDelay is how often the prune loop scans for
+// subscriptions that have been failing with 404/410 for too long.
+// webpushPruneSubscriptionDelay is how long a subscription is allowed to
+// keep failing before it is deleted.
+const (
+	webpushCheckSubscriptionDelay = 10 * time.Minute
+	webpushPruneSubscriptionDelay = 30 * 24 * time.Hour
+	pushSnippetMaxLen             = 140
+)
+
+var (
+	vapidPublicKey  = getEnv("VAPID_PUBLIC_KEY", "")
+	vapidPrivateKey = getEnv("VAPID_PRIVATE_KEY", "")
+	vapidSubject    = getEnv("VAPID_SUBJECT", "mailto:admin@example.com")
+
+	pushSentTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "push_sent_total",
+		Help: "Total number of web push notifications delivered successfully",
+	})
+	pushFailedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "push_failed_total",
+		Help: "Total number of web push notifications that failed to send",
+	})
+	pushExpiredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "push_expired_total",
+		Help: "Total number of push subscriptions pruned after repeated 404/410 responses",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pushSentTotal)
+	prometheus.MustRegister(pushFailedTotal)
+	prometheus.MustRegister(pushExpiredTotal)
+}
+
+func initPushTables() {
+	createTables := `
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(id),
+		endpoint TEXT NOT NULL,
+		p256dh VARCHAR(255) NOT NULL,
+		auth VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		failing_since TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user_id ON push_subscriptions(user_id);
+
+	ALTER TABLE push_subscriptions ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id);
+
+	CREATE INDEX IF NOT EXISTS idx_push_subscriptions_room_id ON push_subscriptions(room_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_push_subscriptions_endpoint_room ON push_subscriptions(endpoint, room_id);
+	`
+
+	if _, err := db.Exec(createTables); err != nil {
+		log.Fatal("Failed to create push subscription tables:", err)
+	}
+}
+
+func getVapidPublicKey(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"public_key": vapidPublicKey})
+}
+
+func registerPushSubscription(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	var req RegisterPushSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	query := `
+		INSERT INTO push_subscriptions (user_id, room_id, endpoint, p256dh, auth)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint, room_id) DO UPDATE
+		SET user_id = $1, p256dh = $4, auth = $5, last_seen_at = CURRENT_TIMESTAMP, failing_since = NULL
+		RETURNING id
+	`
+
+	var sub PushSubscription
+	sub.UserID = principal.UserID
+	sub.RoomID = req.RoomID
+	sub.Endpoint = req.Endpoint
+	sub.P256dh = req.P256dh
+	sub.Auth = req.Auth
+
+	if err := db.QueryRow(query, sub.UserID, sub.RoomID, req.Endpoint, req.P256dh, req.Auth).Scan(&sub.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save push subscription"})
+	}
+
+	return c.Status(201).JSON(sub)
+}
+
+func unregisterPushSubscription(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	var req UnregisterPushSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	result, err := db.Exec(`DELETE FROM push_subscriptions WHERE endpoint = $1 AND user_id = $2`, req.Endpoint, principal.UserID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove push subscription"})
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Subscription not found"})
+	}
+
+	return c.SendStatus(204)
+}
+
+// notifyOfflinePush fans the message out to every subscription registered
+// for msg.RoomID whose user does not currently hold an open WebSocket
+// connection to that room.
+func notifyOfflinePush(msg Message) {
+	if vapidPublicKey == "" || vapidPrivateKey == "" {
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT id, user_id, endpoint, p256dh, auth FROM push_subscriptions WHERE room_id = $1`,
+		msg.RoomID,
+	)
+	if err != nil {
+		log.Println("Failed to load push subscriptions:", err)
+		return
+	}
+	defer rows.Close()
+
+	var subs []PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth); err != nil {
+			log.Println("Failed to scan push subscription:", err)
+			continue
+		}
+		if isUserConnectedToRoom(sub.UserID, msg.RoomID) {
+			continue
+		}
+		subs = append(subs, sub)
+	}
+
+	snippet := msg.Content
+	if len(snippet) > pushSnippetMaxLen {
+		snippet = snippet[:pushSnippetMaxLen]
+	}
+	payload, err := json.Marshal(pushMessagePayload{
+		MessageID: msg.ID,
+		Username:  msg.Username,
+		Snippet:   snippet,
+	})
+	if err != nil {
+		log.Println("Failed to marshal push payload:", err)
+		return
+	}
+
+	for _, sub := range subs {
+		sendPushNotification(sub, payload)
+	}
+}
+
+func sendPushNotification(sub PushSubscription, payload []byte) {
+	resp, err := webpush.SendNotification(payload, &webpush.Subscription{
+		Endpoint: sub.Endpoint,
+		Keys: webpush.Keys{
+			P256dh: sub.P256dh,
+			Auth:   sub.Auth,
+		},
+	}, &webpush.Options{
+		Subscriber:      vapidSubject,
+		VAPIDPublicKey:  vapidPublicKey,
+		VAPIDPrivateKey: vapidPrivateKey,
+		TTL:             60,
+	})
+	if err != nil {
+		pushFailedTotal.Inc()
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		pushFailedTotal.Inc()
+		markPushSubscriptionFailing(sub.ID)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		pushFailedTotal.Inc()
+		return
+	}
+
+	pushSentTotal.Inc()
+	db.Exec(`UPDATE push_subscriptions SET last_seen_at = CURRENT_TIMESTAMP, failing_since = NULL WHERE id = $1`, sub.ID)
+}
+
+func markPushSubscriptionFailing(id int) {
+	db.Exec(`UPDATE push_subscriptions SET failing_since = COALESCE(failing_since, CURRENT_TIMESTAMP) WHERE id = $1`, id)
+}
+
+// prunePushSubscriptions periodically deletes subscriptions that have been
+// returning 404/410 for longer than webpushPruneSubscriptionDelay.
+func prunePushSubscriptions() {
+	ticker := time.NewTicker(webpushCheckSubscriptionDelay)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-webpushPruneSubscriptionDelay)
+		result, err := db.Exec(`DELETE FROM push_subscriptions WHERE failing_since IS NOT NULL AND failing_since < $1`, cutoff)
+		if err != nil {
+			log.Println("Failed to prune push subscriptions:", err)
+			continue
+		}
+		if rows, _ := result.RowsAffected(); rows > 0 {
+			pushExpiredTotal.Add(float64(rows))
+			log.Printf("Pruned %d expired push subscriptions", rows)
+		}
+	}
+}
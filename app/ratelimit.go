@@ -0,0 +1,183 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// upstreamMessageDelay/upstreamMessageBurst bound how fast a single
+// connection may feed messages in: one token refills every
+// upstreamMessageDelay, up to a burst of upstreamMessageBurst.
+// writeTimeout bounds how long a single outbound write may block, and
+// outboundQueueSize is the per-client backlog before we start dropping the
+// oldest queued message so one slow socket can't stall the broadcast loop.
+const (
+	upstreamMessageDelay   = 2 * time.Second
+	upstreamMessageBurst   = 10
+	maxRateLimitViolations = 3
+	writeTimeout           = 10 * time.Second
+	outboundQueueSize      = 64
+)
+
+var (
+	chatWriteTimeoutsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chat_write_timeouts_total",
+		Help: "Total number of WebSocket writes that missed their write deadline",
+	})
+	chatRateLimitedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chat_rate_limited_total",
+		Help: "Total number of inbound messages rejected by the per-connection rate limiter",
+	})
+	chatSlowClientDropsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chat_slow_client_drops_total",
+		Help: "Total number of queued outbound messages dropped because a client's send queue was full",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(chatWriteTimeoutsTotal)
+	prometheus.MustRegister(chatRateLimitedTotal)
+	prometheus.MustRegister(chatSlowClientDropsTotal)
+}
+
+// tokenBucket is a minimal token-bucket limiter: it starts full at
+// `burst` tokens and refills one token every `refillEvery`.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func newTokenBucket(burst int, refillEvery time.Duration) *tokenBucket {
+	return &tokenBucket{
+		tokens:   float64(burst),
+		capacity: float64(burst),
+		rate:     1 / refillEvery.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// outboundQueue pairs a connection's bounded send queue with a done signal
+// so unregisterOutboundQueue can stop its pump goroutine without closing
+// frames - enqueueOutbound may still hold a reference to frames after the
+// connection is removed from outboundQueues, and sending on a closed
+// channel panics.
+type outboundQueue struct {
+	frames chan interface{}
+	done   chan struct{}
+}
+
+// outboundQueues holds each connection's bounded send queue, drained by a
+// dedicated pump goroutine so a stalled peer can't block handleBroadcast.
+// Every frame sent to a connection after registerOutboundQueue must go
+// through this queue: gofiber/websocket connections aren't safe for
+// concurrent writes from multiple goroutines.
+var outboundQueues = make(map[*websocket.Conn]*outboundQueue)
+
+func registerOutboundQueue(c *websocket.Conn) {
+	queue := &outboundQueue{
+		frames: make(chan interface{}, outboundQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	hubMu.Lock()
+	outboundQueues[c] = queue
+	hubMu.Unlock()
+
+	go pumpOutbound(c, queue)
+}
+
+func unregisterOutboundQueue(c *websocket.Conn) {
+	hubMu.Lock()
+	queue, ok := outboundQueues[c]
+	if ok {
+		delete(outboundQueues, c)
+	}
+	hubMu.Unlock()
+
+	if ok {
+		close(queue.done)
+	}
+}
+
+func pumpOutbound(c *websocket.Conn, queue *outboundQueue) {
+	for {
+		select {
+		case frame := <-queue.frames:
+			if err := writeWithDeadline(c, frame); err != nil {
+				log.Println("WebSocket write error:", err)
+				c.Close()
+				return
+			}
+		case <-queue.done:
+			return
+		}
+	}
+}
+
+func writeWithDeadline(c *websocket.Conn, frame interface{}) error {
+	c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err := c.WriteJSON(frame)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		chatWriteTimeoutsTotal.Inc()
+	}
+	return err
+}
+
+// enqueueOutbound hands frame to the client's send queue, dropping the
+// oldest queued frame when the queue is full rather than blocking.
+func enqueueOutbound(c *websocket.Conn, frame interface{}) {
+	hubMu.Lock()
+	queue, ok := outboundQueues[c]
+	hubMu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case queue.frames <- frame:
+		return
+	default:
+	}
+
+	select {
+	case <-queue.frames:
+		chatSlowClientDropsTotal.Inc()
+	default:
+	}
+
+	select {
+	case queue.frames <- frame:
+	default:
+	}
+}
+
+func rateLimitExceededFrame() fiber.Map {
+	return fiber.Map{"error": "rate limit exceeded, slow down"}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketStartsFullAndDrains(t *testing.T) {
+	b := newTokenBucket(3, time.Second)
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("Allow() #%d = false, want true (bucket should start full)", i+1)
+		}
+	}
+
+	if b.Allow() {
+		t.Fatal("Allow() = true after draining the bucket, want false")
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(1, 100*time.Millisecond)
+
+	if !b.Allow() {
+		t.Fatal("Allow() = false on a fresh bucket, want true")
+	}
+	if b.Allow() {
+		t.Fatal("Allow() = true immediately after draining, want false")
+	}
+
+	b.last = b.last.Add(-100 * time.Millisecond)
+
+	if !b.Allow() {
+		t.Fatal("Allow() = false after a full refill interval elapsed, want true")
+	}
+}
+
+func TestTokenBucketRefillCapsAtCapacity(t *testing.T) {
+	b := newTokenBucket(2, 10*time.Millisecond)
+
+	b.last = b.last.Add(-time.Hour)
+	b.Allow()
+
+	if b.tokens > b.capacity {
+		t.Fatalf("tokens = %v after a long idle period, want capped at capacity %v", b.tokens, b.capacity)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+type Room struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	OwnerID     int       `json:"owner_id" db:"owner_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateRoomRequest struct {
+	Name        string `json:"name" validate:"required,min=1,max=50"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+// defaultRoomID is the "general" room every pre-existing message and
+// room-less WebSocket connection falls back to.
+var defaultRoomID int
+
+// roomClients tracks, per room, which WebSocket connections are currently
+// subscribed to it.
+var roomClients = make(map[int]map[*websocket.Conn]bool)
+
+func initRoomTables() {
+	createTables := `
+	CREATE TABLE IF NOT EXISTS rooms (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(50) UNIQUE NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		owner_id INTEGER REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS room_members (
+		room_id INTEGER NOT NULL REFERENCES rooms(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (room_id, user_id)
+	);
+
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id);
+	`
+
+	if _, err := db.Exec(createTables); err != nil {
+		log.Fatal("Failed to create room tables:", err)
+	}
+
+	if err := db.QueryRow(
+		`INSERT INTO rooms (name, description) VALUES ('general', 'Default room')
+		 ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		 RETURNING id`,
+	).Scan(&defaultRoomID); err != nil {
+		log.Fatal("Failed to ensure default room:", err)
+	}
+
+	if _, err := db.Exec(`UPDATE messages SET room_id = $1 WHERE room_id IS NULL`, defaultRoomID); err != nil {
+		log.Fatal("Failed to assign pre-existing messages to the default room:", err)
+	}
+}
+
+func roomExists(roomID int) bool {
+	var exists bool
+	db.QueryRow(`SELECT EXISTS(SELECT 1 FROM rooms WHERE id = $1)`, roomID).Scan(&exists)
+	return exists
+}
+
+func roomIDByName(name string) (int, bool) {
+	var id int
+	if err := db.QueryRow(`SELECT id FROM rooms WHERE name = $1`, name).Scan(&id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+func roomNameByID(roomID int) (string, bool) {
+	var name string
+	if err := db.QueryRow(`SELECT name FROM rooms WHERE id = $1`, roomID).Scan(&name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+func registerRoomClient(roomID int, c *websocket.Conn) {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+
+	if roomClients[roomID] == nil {
+		roomClients[roomID] = make(map[*websocket.Conn]bool)
+	}
+	roomClients[roomID][c] = true
+}
+
+func unregisterRoomClient(roomID int, c *websocket.Conn) {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+	delete(roomClients[roomID], c)
+}
+
+// roomClientsSnapshot copies the current subscriber set for a room so
+// callers (handleBroadcast) can enqueue to each client without holding
+// hubMu for the duration of the fan-out.
+func roomClientsSnapshot(roomID int) []*websocket.Conn {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+
+	snapshot := make([]*websocket.Conn, 0, len(roomClients[roomID]))
+	for c := range roomClients[roomID] {
+		snapshot = append(snapshot, c)
+	}
+	return snapshot
+}
+
+func createRoom(c *fiber.Ctx) error {
+	principal := c.Locals("principal").(*AuthClaims)
+
+	var req CreateRoomRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	query := `
+		INSERT INTO rooms (name, description, owner_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	var room Room
+	room.Name = req.Name
+	room.Description = req.Description
+	room.OwnerID = principal.UserID
+
+	if err := db.QueryRow(query, room.Name, room.Description, room.OwnerID).Scan(&room.ID, &room.CreatedAt); err != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Room already exists"})
+	}
+
+	if _, err := db.Exec(`INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)`, room.ID, room.OwnerID); err != nil {
+		log.Println("Failed to add room owner as member:", err)
+	}
+
+	return c.Status(201).JSON(room)
+}
+
+func getRooms(c *fiber.Ctx) error {
+	rows, err := db.Query(`SELECT id, name, description, owner_id, created_at FROM rooms ORDER BY name`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+	}
+	defer rows.Close()
+
+	var rooms []Room
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.ID, &room.Name, &room.Description, &room.OwnerID, &room.CreatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan room"})
+		}
+		rooms = append(rooms, room)
+	}
+
+	return c.JSON(rooms)
+}
+
+func getRoomMessages(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid room id"})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+
+	query := `
+		SELECT id, user_id, username, content, room_id, created_at
+		FROM messages
+		WHERE room_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := db.Query(query, roomID, limit, offset)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.RoomID, &msg.CreatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan message"})
+		}
+		messages = append(messages, msg)
+	}
+
+	return c.JSON(messages)
+}
+
+func roomIDLabel(roomID int) string {
+	return strconv.Itoa(roomID)
+}